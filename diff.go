@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+)
+
+// HunkLine is a single line of a unified-diff hunk.
+type HunkLine struct {
+	Kind string // "context", "del", or "add"
+	Text string
+}
+
+// Hunk is one "@@ ... @@" block of a unified diff.
+type Hunk struct {
+	Header string
+	Lines  []HunkLine
+}
+
+// matchSpan is a byte range in the original content that a replacement
+// touched, along with the bytes it was replaced with.
+type matchSpan struct {
+	start, end  int
+	replacement []byte
+}
+
+// buildHunks produces the unified-diff hunks describing the effect of
+// replacing each span in matches with its replacement text, using context
+// lines of surrounding, unchanged content around each changed region.
+// Because every change is a known substitution, hunk locations are seeded
+// from the match byte offsets and expanded to line boundaries, rather than
+// diffing the whole file.
+func buildHunks(before []byte, matches []matchSpan, context int) []Hunk {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	lineStarts := lineStartOffsets(before)
+	lineOf := func(offset int) int {
+		return sort.Search(len(lineStarts), func(i int) bool {
+			return i+1 == len(lineStarts) || lineStarts[i+1] > offset
+		})
+	}
+
+	type region struct {
+		startLine, endLine int
+		matches            []matchSpan
+	}
+
+	var regions []region
+	for _, m := range matches {
+		startLine := lineOf(m.start)
+		endOffset := m.end
+		if endOffset > m.start {
+			endOffset--
+		}
+		endLine := lineOf(endOffset)
+
+		if len(regions) > 0 {
+			last := &regions[len(regions)-1]
+			if startLine <= last.endLine+2*context+1 {
+				last.endLine = endLine
+				last.matches = append(last.matches, m)
+				continue
+			}
+		}
+		regions = append(regions, region{startLine: startLine, endLine: endLine, matches: []matchSpan{m}})
+	}
+
+	lineText := func(idx int) string {
+		start := lineStarts[idx]
+		end := len(before)
+		if idx+1 < len(lineStarts) {
+			end = lineStarts[idx+1]
+		}
+		return string(bytes.TrimSuffix(before[start:end], []byte("\n")))
+	}
+
+	lastLine := len(lineStarts) - 1
+	afterLineOffset := 0
+	var hunks []Hunk
+
+	for _, r := range regions {
+		beforeStart := r.startLine - context
+		if beforeStart < 0 {
+			beforeStart = 0
+		}
+		beforeEnd := r.endLine + context
+		if beforeEnd > lastLine {
+			beforeEnd = lastLine
+		}
+
+		// Matches that land on the same (or overlapping) lines must be
+		// rendered together, or later ones on an already-consumed line
+		// would be silently dropped from the preview.
+		type block struct {
+			startLine, endLine int
+			matches            []matchSpan
+		}
+		var blocks []block
+		for _, m := range r.matches {
+			ms, me := lineOf(m.start), lineOf(maxInt(m.start, m.end-1))
+			if len(blocks) > 0 && ms <= blocks[len(blocks)-1].endLine {
+				b := &blocks[len(blocks)-1]
+				if me > b.endLine {
+					b.endLine = me
+				}
+				b.matches = append(b.matches, m)
+				continue
+			}
+			blocks = append(blocks, block{startLine: ms, endLine: me, matches: []matchSpan{m}})
+		}
+
+		var lines []HunkLine
+		delta := 0
+		lineIdx := beforeStart
+		for lineIdx <= beforeEnd {
+			matched := false
+			for _, b := range blocks {
+				if lineIdx != b.startLine {
+					continue
+				}
+
+				spanStart := lineStarts[b.startLine]
+				spanEnd := len(before)
+				if b.endLine+1 < len(lineStarts) {
+					spanEnd = lineStarts[b.endLine+1]
+				}
+				spanBefore := before[spanStart:spanEnd]
+
+				spanAfter := make([]byte, 0, len(spanBefore))
+				cursor := 0
+				for _, m := range b.matches {
+					localStart := m.start - spanStart
+					localEnd := m.end - spanStart
+					spanAfter = append(spanAfter, spanBefore[cursor:localStart]...)
+					spanAfter = append(spanAfter, m.replacement...)
+					cursor = localEnd
+				}
+				spanAfter = append(spanAfter, spanBefore[cursor:]...)
+
+				beforeLines := splitLines(spanBefore)
+				afterLines := splitLines(spanAfter)
+
+				for _, l := range beforeLines {
+					lines = append(lines, HunkLine{Kind: "del", Text: l})
+				}
+				for _, l := range afterLines {
+					lines = append(lines, HunkLine{Kind: "add", Text: l})
+				}
+
+				delta += len(afterLines) - len(beforeLines)
+				lineIdx = b.endLine + 1
+				matched = true
+				break
+			}
+			if matched {
+				continue
+			}
+
+			lines = append(lines, HunkLine{Kind: "context", Text: lineText(lineIdx)})
+			lineIdx++
+		}
+
+		beforeCount := beforeEnd - beforeStart + 1
+		afterCount := beforeCount + delta
+		afterStart := beforeStart + afterLineOffset
+
+		hunks = append(hunks, Hunk{
+			Header: formatHunkHeader(beforeStart+1, beforeCount, afterStart+1, afterCount),
+			Lines:  lines,
+		})
+
+		afterLineOffset += delta
+	}
+
+	return hunks
+}
+
+func lineStartOffsets(data []byte) []int {
+	starts := []int{0}
+	for i, b := range data {
+		if b == '\n' && i+1 < len(data) {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func splitLines(data []byte) []string {
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	if len(data) == 0 {
+		return nil
+	}
+	parts := bytes.Split(data, []byte("\n"))
+	lines := make([]string, len(parts))
+	for i, p := range parts {
+		lines[i] = string(p)
+	}
+	return lines
+}
+
+func formatHunkHeader(beforeStart, beforeCount, afterStart, afterCount int) string {
+	return "@@ -" + hunkRange(beforeStart, beforeCount) + " +" + hunkRange(afterStart, afterCount) + " @@"
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return strconv.Itoa(start)
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(count)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestBuildHunksSingleMatch(t *testing.T) {
+	before := []byte("line1\nline2\nhello\nline4\nline5\n")
+	matches := []matchSpan{
+		{start: 12, end: 17, replacement: []byte("goodbye")},
+	}
+
+	hunks := buildHunks(before, matches, 1)
+	if len(hunks) != 1 {
+		t.Fatalf("len(hunks) = %d, want 1", len(hunks))
+	}
+
+	h := hunks[0]
+	if h.Header != "@@ -2,3 +2,3 @@" {
+		t.Errorf("header = %q, want %q", h.Header, "@@ -2,3 +2,3 @@")
+	}
+
+	want := []HunkLine{
+		{Kind: "context", Text: "line2"},
+		{Kind: "del", Text: "hello"},
+		{Kind: "add", Text: "goodbye"},
+		{Kind: "context", Text: "line4"},
+	}
+	assertHunkLines(t, h.Lines, want)
+}
+
+func TestBuildHunksNoMatches(t *testing.T) {
+	if hunks := buildHunks([]byte("line1\n"), nil, 3); hunks != nil {
+		t.Errorf("buildHunks with no matches = %v, want nil", hunks)
+	}
+}
+
+func TestBuildHunksZeroContext(t *testing.T) {
+	before := []byte("hello\nworld\n")
+	matches := []matchSpan{
+		{start: 0, end: 5, replacement: []byte("goodbye")},
+	}
+
+	hunks := buildHunks(before, matches, 0)
+	if len(hunks) != 1 {
+		t.Fatalf("len(hunks) = %d, want 1", len(hunks))
+	}
+
+	want := []HunkLine{
+		{Kind: "del", Text: "hello"},
+		{Kind: "add", Text: "goodbye"},
+	}
+	assertHunkLines(t, hunks[0].Lines, want)
+}
+
+func TestBuildHunksMultipleMatchesSameLine(t *testing.T) {
+	before := []byte("hello hello\n")
+	matches := []matchSpan{
+		{start: 0, end: 5, replacement: []byte("goodbye")},
+		{start: 6, end: 11, replacement: []byte("goodbye")},
+	}
+
+	hunks := buildHunks(before, matches, 0)
+	if len(hunks) != 1 {
+		t.Fatalf("len(hunks) = %d, want 1", len(hunks))
+	}
+
+	want := []HunkLine{
+		{Kind: "del", Text: "hello hello"},
+		{Kind: "add", Text: "goodbye goodbye"},
+	}
+	assertHunkLines(t, hunks[0].Lines, want)
+}
+
+func TestBuildHunksDistantMatchesProduceSeparateHunks(t *testing.T) {
+	lines := "hello\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nhello\n"
+	before := []byte(lines)
+	matches := []matchSpan{
+		{start: 0, end: 5, replacement: []byte("x")},
+		{start: len(lines) - 6, end: len(lines) - 1, replacement: []byte("x")},
+	}
+
+	hunks := buildHunks(before, matches, 1)
+	if len(hunks) != 2 {
+		t.Fatalf("len(hunks) = %d, want 2", len(hunks))
+	}
+}
+
+func assertHunkLines(t *testing.T, got []HunkLine, want []HunkLine) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("lines = %+v, want %+v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("line[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
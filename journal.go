@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// journalRecord is a single entry written to a run's entries.jsonl, one
+// line per file touched during that run.
+type journalRecord struct {
+	Path         string    `json:"path"`
+	SHA256Before string    `json:"sha256_before"`
+	SHA256After  string    `json:"sha256_after"`
+	Mode         uint32    `json:"mode"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// Journal records every file a run writes so that it can be undone later.
+// Before overwriting a file, the original bytes are saved to a
+// content-addressed backup under the run directory; entries.jsonl then
+// records the before/after hashes needed to safely restore it.
+type Journal struct {
+	RunID string
+	Dir   string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// journalRoot returns the base directory runs are stored under:
+// replace/runs inside os.UserCacheDir() (~/.cache/replace/runs on Linux).
+func journalRoot() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "replace", "runs"), nil
+}
+
+// NewJournal starts a new run, creating its directory under journalRoot().
+func NewJournal() (*Journal, error) {
+	root, err := journalRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	runID := time.Now().UTC().Format("20060102T150405.000000000Z")
+	dir := filepath.Join(root, runID)
+	if err := os.MkdirAll(filepath.Join(dir, "backups"), 0o755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, "entries.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{RunID: runID, Dir: dir, f: f}, nil
+}
+
+// Close closes the underlying entries file. It does not remove anything.
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+// Record saves before as a content-addressed backup and appends an entry
+// describing the path, mode, and before/after hashes of the write.
+func (j *Journal) Record(path string, before, after []byte, mode os.FileMode) error {
+	shaBefore := sha256Hex(before)
+	shaAfter := sha256Hex(after)
+
+	j.mu.Lock()
+	backupPath := filepath.Join(j.Dir, "backups", shaBefore)
+	_, statErr := os.Stat(backupPath)
+	needsBackup := errors.Is(statErr, fs.ErrNotExist)
+	j.mu.Unlock()
+
+	if needsBackup {
+		if err := os.WriteFile(backupPath, before, 0o644); err != nil {
+			return err
+		}
+	}
+
+	return j.appendRecord(path, shaBefore, shaAfter, mode)
+}
+
+// adoptBackup moves the temp file at tmpPath into the run's content-addressed
+// backups directory under sha, discarding it if a backup with that hash
+// already exists.
+func (j *Journal) adoptBackup(tmpPath, sha string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	finalPath := filepath.Join(j.Dir, "backups", sha)
+	if _, err := os.Stat(finalPath); errors.Is(err, fs.ErrNotExist) {
+		return os.Rename(tmpPath, finalPath)
+	}
+	return os.Remove(tmpPath)
+}
+
+// appendRecord writes a single entries.jsonl line for path.
+func (j *Journal) appendRecord(path, shaBefore, shaAfter string, mode os.FileMode) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	record := journalRecord{
+		Path:         absPath,
+		SHA256Before: shaBefore,
+		SHA256After:  shaAfter,
+		Mode:         uint32(mode),
+		Timestamp:    time.Now().UTC(),
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.f.Write(line)
+	return err
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// atomicWriteFile writes content to a temp file in the same directory as
+// path and renames it into place, so a reader never observes a partial
+// write and the process can be killed mid-write without corrupting path.
+func atomicWriteFile(path string, content []byte, mode os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, ".replace-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// readJournalRecords loads every entry recorded for runID, in the order
+// they were written.
+func readJournalRecords(runID string) ([]journalRecord, error) {
+	root, err := journalRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(root, runID, "entries.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []journalRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var record journalRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// runUndo restores every file touched by runID, walking its journal in
+// reverse and refusing to clobber any file whose current contents no
+// longer match what the run last wrote.
+func runUndo(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "使い方: replace undo <run-id>")
+		os.Exit(1)
+	}
+	runID := args[0]
+
+	records, err := readJournalRecords(runID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "エラー: run %s を読み込めません: %v\n", runID, err)
+		os.Exit(1)
+	}
+
+	root, err := journalRoot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	restored, skipped := 0, 0
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+
+		current, err := os.ReadFile(record.Path)
+		if err != nil {
+			fmt.Printf("  [スキップ] %s: 読み込めません (%v)\n", record.Path, err)
+			skipped++
+			continue
+		}
+		if sha256Hex(current) != record.SHA256After {
+			fmt.Printf("  [スキップ] %s: 変更後のハッシュが一致しないため復元しません\n", record.Path)
+			skipped++
+			continue
+		}
+
+		backup, err := os.ReadFile(filepath.Join(root, runID, "backups", record.SHA256Before))
+		if err != nil {
+			fmt.Printf("  [スキップ] %s: バックアップを読み込めません (%v)\n", record.Path, err)
+			skipped++
+			continue
+		}
+
+		if err := atomicWriteFile(record.Path, backup, os.FileMode(record.Mode)); err != nil {
+			fmt.Printf("  [スキップ] %s: 復元に失敗しました (%v)\n", record.Path, err)
+			skipped++
+			continue
+		}
+
+		fmt.Printf("  [復元] %s\n", record.Path)
+		restored++
+	}
+
+	fmt.Println()
+	fmt.Printf("復元: %d件, スキップ: %d件\n", restored, skipped)
+}
+
+// runListRuns prints every run recorded under journalRoot(), most recent
+// first.
+func runListRuns(args []string) {
+	root, err := journalRoot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			fmt.Println("実行履歴がありません")
+			return
+		}
+		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !e.IsDir() {
+			continue
+		}
+		records, err := readJournalRecords(e.Name())
+		if err != nil {
+			continue
+		}
+		fmt.Printf("%s (%d件)\n", e.Name(), len(records))
+	}
+}
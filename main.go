@@ -2,11 +2,13 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -16,30 +18,89 @@ type Result struct {
 	Path         string
 	Replacements int
 	Err          error
+	Hunks        []Hunk // populated in dry-run mode only
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "undo":
+			runUndo(os.Args[2:])
+			return
+		case "runs":
+			runListRuns(os.Args[2:])
+			return
+		}
+	}
+
+	runReplace(os.Args[1:])
+}
+
+func runReplace(args []string) {
 	var (
-		oldWord    string
-		newWord    string
-		targetPath string
-		workers    int
-		dryRun     bool
+		oldWord         string
+		newWord         string
+		targetPath      string
+		workers         int
+		dryRun          bool
+		cliRules        []cliRule
+		regexMode       bool
+		ignoreCase      bool
+		wordMode        bool
+		streamThreshold int64
+		contextLines    int
+		outputFormat    string
 	)
 
-	flag.StringVar(&oldWord, "old", "", "置換対象の単語 (必須)")
-	flag.StringVar(&newWord, "new", "", "置換後の単語 (必須)")
-	flag.StringVar(&targetPath, "path", "", "対象のファイルまたはディレクトリのパス (必須)")
-	flag.IntVar(&workers, "workers", runtime.NumCPU(), "並列処理のワーカー数")
-	flag.BoolVar(&dryRun, "dry-run", false, "実際には置換せず、対象ファイルを表示する")
-	flag.Parse()
+	flagSet := flag.NewFlagSet("replace", flag.ExitOnError)
+	flagSet.StringVar(&oldWord, "old", "", "置換対象の単語 (必須)")
+	flagSet.StringVar(&newWord, "new", "", "置換後の単語 (必須)")
+	flagSet.StringVar(&targetPath, "path", "", "対象のファイルまたはディレクトリのパス (必須)")
+	flagSet.IntVar(&workers, "workers", runtime.NumCPU(), "並列処理のワーカー数")
+	flagSet.BoolVar(&dryRun, "dry-run", false, "実際には置換せず、対象ファイルを表示する")
+	flagSet.Var(newCLIPatternFlag(&cliRules, true), "include", "対象に含めるパターン (gitignore形式, 複数指定可)")
+	flagSet.Var(newCLIPatternFlag(&cliRules, false), "exclude", "対象から除外するパターン (gitignore形式, 複数指定可)")
+	flagSet.BoolVar(&regexMode, "regex", false, "-old をRE2正規表現として扱い、-new を $1 や ${name} を使える置換テンプレートとして扱う")
+	flagSet.BoolVar(&ignoreCase, "ignore-case", false, "大文字小文字を区別せずに置換する")
+	flagSet.BoolVar(&wordMode, "word", false, "単語境界 (\\b) で囲んだパターンとして置換する (リテラルモードのみ)")
+	flagSet.Int64Var(&streamThreshold, "stream-threshold", defaultStreamThreshold, "このサイズ(バイト)を超えるファイルはストリーミング処理する (-regex, -ignore-case, -word, -dry-run のいずれも指定しない場合のみ)")
+	flagSet.IntVar(&contextLines, "context", 3, "-dry-run の差分に含める前後の文脈行数")
+	flagSet.StringVar(&outputFormat, "output", "text", "結果の出力形式 (text または json)")
+	flagSet.Parse(args)
 
 	if oldWord == "" || newWord == "" || targetPath == "" {
 		fmt.Fprintln(os.Stderr, "エラー: -old, -new, -path は必須です")
-		flag.Usage()
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if outputFormat != "text" && outputFormat != "json" {
+		fmt.Fprintf(os.Stderr, "エラー: -output は text または json を指定してください\n")
+		os.Exit(1)
+	}
+
+	if contextLines < 0 {
+		fmt.Fprintf(os.Stderr, "エラー: -context は0以上の値を指定してください\n")
+		os.Exit(1)
+	}
+
+	if wordMode && regexMode {
+		fmt.Fprintf(os.Stderr, "エラー: -word は -regex と同時に指定できません\n")
 		os.Exit(1)
 	}
 
+	pattern, err := compileReplacePattern(oldWord, regexMode, ignoreCase, wordMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "エラー: -old を正規表現としてコンパイルできません: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Only -regex treats -new as a template. When -ignore-case or -word
+	// drive a regexp in literal mode, escape "$" so -new is inserted verbatim.
+	if pattern != nil && !regexMode {
+		newWord = string(bytes.ReplaceAll([]byte(newWord), []byte("$"), []byte("$$")))
+	}
+
 	info, err := os.Stat(targetPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "エラー: パスが見つかりません: %s\n", targetPath)
@@ -48,7 +109,12 @@ func main() {
 
 	var files []string
 	if info.IsDir() {
-		files, err = collectFiles(targetPath)
+		matcher, err := NewPathMatcher(targetPath, cliRules)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: パターンのコンパイルに失敗しました: %v\n", err)
+			os.Exit(1)
+		}
+		files, err = collectFiles(targetPath, matcher)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "エラー: ディレクトリの走査に失敗しました: %v\n", err)
 			os.Exit(1)
@@ -62,12 +128,50 @@ func main() {
 		return
 	}
 
-	results := processFiles(files, oldWord, newWord, workers, dryRun)
+	var journal *Journal
+	if !dryRun {
+		journal, err = NewJournal()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: 実行履歴を作成できません: %v\n", err)
+			os.Exit(1)
+		}
+		defer journal.Close()
+	}
+
+	results := processFiles(files, oldWord, newWord, workers, dryRun, pattern, journal, streamThreshold, contextLines)
 
-	printResults(results, dryRun)
+	printResults(results, dryRun, outputFormat)
+
+	if journal != nil && outputFormat == "text" {
+		fmt.Printf("run-id: %s (取り消す場合は `replace undo %s`)\n", journal.RunID, journal.RunID)
+	}
+}
+
+// compileReplacePattern builds the *regexp.Regexp to drive replaceInFile,
+// or nil if the literal bytes.ReplaceAll path should be used instead.
+// regexMode treats old as an RE2 pattern as-is; otherwise old is escaped
+// with regexp.QuoteMeta first, optionally wrapped with \b for wordMode.
+// ignoreCase prepends the (?i) flag in either case.
+func compileReplacePattern(old string, regexMode, ignoreCase, wordMode bool) (*regexp.Regexp, error) {
+	if !regexMode && !ignoreCase && !wordMode {
+		return nil, nil
+	}
+
+	pattern := old
+	if !regexMode {
+		pattern = regexp.QuoteMeta(pattern)
+		if wordMode {
+			pattern = `\b` + pattern + `\b`
+		}
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+
+	return regexp.Compile(pattern)
 }
 
-func collectFiles(root string) ([]string, error) {
+func collectFiles(root string, matcher *PathMatcher) ([]string, error) {
 	var files []string
 
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
@@ -75,15 +179,34 @@ func collectFiles(root string) ([]string, error) {
 			return err
 		}
 
+		if path == root {
+			return matcher.LoadIgnoreFiles(root)
+		}
+
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
 		if d.IsDir() {
-			name := d.Name()
-			if name == ".git" || name == "node_modules" || name == "vendor" {
+			if err := matcher.LoadIgnoreFiles(path); err != nil {
+				return err
+			}
+			if !matcher.ShouldInclude(rel, true) {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		if isTextFile(path) {
+		if matcher.ShouldInclude(rel, false) {
 			files = append(files, path)
 		}
 
@@ -93,25 +216,7 @@ func collectFiles(root string) ([]string, error) {
 	return files, err
 }
 
-func isTextFile(path string) bool {
-	ext := filepath.Ext(path)
-	textExtensions := map[string]bool{
-		".go": true, ".txt": true, ".md": true, ".json": true,
-		".yaml": true, ".yml": true, ".xml": true, ".html": true,
-		".css": true, ".js": true, ".ts": true, ".jsx": true,
-		".tsx": true, ".py": true, ".rb": true, ".java": true,
-		".c": true, ".cpp": true, ".h": true, ".hpp": true,
-		".rs": true, ".sh": true, ".bash": true, ".zsh": true,
-		".sql": true, ".graphql": true, ".proto": true,
-		".toml": true, ".ini": true, ".conf": true, ".cfg": true,
-		".env": true, ".gitignore": true, ".dockerfile": true,
-		"": true,
-	}
-
-	return textExtensions[ext]
-}
-
-func processFiles(files []string, oldWord, newWord string, workers int, dryRun bool) []Result {
+func processFiles(files []string, oldWord, newWord string, workers int, dryRun bool, pattern *regexp.Regexp, journal *Journal, streamThreshold int64, context int) []Result {
 	fileChan := make(chan string, len(files))
 	resultChan := make(chan Result, len(files))
 
@@ -122,7 +227,7 @@ func processFiles(files []string, oldWord, newWord string, workers int, dryRun b
 		go func() {
 			defer wg.Done()
 			for path := range fileChan {
-				result := replaceInFile(path, oldWord, newWord, dryRun)
+				result := replaceInFile(path, oldWord, newWord, dryRun, pattern, journal, streamThreshold, context)
 				resultChan <- result
 			}
 		}()
@@ -146,46 +251,116 @@ func processFiles(files []string, oldWord, newWord string, workers int, dryRun b
 	return results
 }
 
-func replaceInFile(path, oldWord, newWord string, dryRun bool) Result {
+func replaceInFile(path, oldWord, newWord string, dryRun bool, pattern *regexp.Regexp, journal *Journal, streamThreshold int64, context int) Result {
+	if pattern == nil && !dryRun {
+		if info, err := os.Stat(path); err == nil && info.Size() > streamThreshold {
+			count, err := streamReplaceInFile(path, oldWord, newWord, info.Mode(), journal)
+			if err != nil {
+				return Result{Path: path, Err: err}
+			}
+			return Result{Path: path, Replacements: count}
+		}
+	}
+
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return Result{Path: path, Err: err}
 	}
 
-	oldBytes := []byte(oldWord)
-	newBytes := []byte(newWord)
-
-	count := bytes.Count(content, oldBytes)
-	if count == 0 {
-		return Result{Path: path, Replacements: 0}
-	}
-
 	if dryRun {
-		return Result{Path: path, Replacements: count}
+		spans := findMatchSpans(content, oldWord, newWord, pattern)
+		if len(spans) == 0 {
+			return Result{Path: path, Replacements: 0}
+		}
+		return Result{Path: path, Replacements: len(spans), Hunks: buildHunks(content, spans, context)}
 	}
 
-	newContent := bytes.ReplaceAll(content, oldBytes, newBytes)
+	var count int
+	var newContent []byte
+
+	if pattern != nil {
+		count = len(pattern.FindAllIndex(content, -1))
+		if count == 0 {
+			return Result{Path: path, Replacements: 0}
+		}
+		newContent = pattern.ReplaceAll(content, []byte(newWord))
+	} else {
+		oldBytes := []byte(oldWord)
+		newBytes := []byte(newWord)
+
+		count = bytes.Count(content, oldBytes)
+		if count == 0 {
+			return Result{Path: path, Replacements: 0}
+		}
+		newContent = bytes.ReplaceAll(content, oldBytes, newBytes)
+	}
 
 	info, err := os.Stat(path)
 	if err != nil {
 		return Result{Path: path, Err: err}
 	}
 
-	err = os.WriteFile(path, newContent, info.Mode())
-	if err != nil {
+	if err := journal.Record(path, content, newContent, info.Mode()); err != nil {
+		return Result{Path: path, Err: err}
+	}
+
+	if err := atomicWriteFile(path, newContent, info.Mode()); err != nil {
 		return Result{Path: path, Err: err}
 	}
 
 	return Result{Path: path, Replacements: count}
 }
 
-func printResults(results []Result, dryRun bool) {
+// findMatchSpans locates every occurrence that would be replaced in
+// content, together with the exact bytes it would be replaced with. For
+// regex mode this expands $1/${name} templates per match via
+// Regexp.Expand so capture-group substitution is reflected accurately.
+func findMatchSpans(content []byte, oldWord, newWord string, pattern *regexp.Regexp) []matchSpan {
+	if pattern != nil {
+		locs := pattern.FindAllSubmatchIndex(content, -1)
+		spans := make([]matchSpan, len(locs))
+		for i, loc := range locs {
+			spans[i] = matchSpan{
+				start:       loc[0],
+				end:         loc[1],
+				replacement: pattern.Expand(nil, []byte(newWord), content, loc),
+			}
+		}
+		return spans
+	}
+
+	oldBytes := []byte(oldWord)
+	newBytes := []byte(newWord)
+
+	var spans []matchSpan
+	offset := 0
+	for {
+		idx := bytes.Index(content[offset:], oldBytes)
+		if idx == -1 {
+			break
+		}
+		start := offset + idx
+		end := start + len(oldBytes)
+		spans = append(spans, matchSpan{start: start, end: end, replacement: newBytes})
+		offset = end
+	}
+	return spans
+}
+
+func printResults(results []Result, dryRun bool, outputFormat string) {
+	if outputFormat == "json" {
+		printResultsJSON(results)
+		return
+	}
+
 	var (
 		totalFiles        int32
 		totalReplacements int32
 		errorCount        int32
 	)
 
+	color := stdoutIsTTY()
+
 	fmt.Println()
 	if dryRun {
 		fmt.Println("=== ドライラン結果 ===")
@@ -206,6 +381,7 @@ func printResults(results []Result, dryRun bool) {
 			atomic.AddInt32(&totalReplacements, int32(r.Replacements))
 			if dryRun {
 				fmt.Printf("  [対象] %s (%d箇所)\n", r.Path, r.Replacements)
+				printHunks(r.Hunks, color)
 			} else {
 				fmt.Printf("  [完了] %s (%d箇所置換)\n", r.Path, r.Replacements)
 			}
@@ -220,3 +396,86 @@ func printResults(results []Result, dryRun bool) {
 		fmt.Printf("エラー数: %d\n", errorCount)
 	}
 }
+
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+	ansiReset = "\x1b[0m"
+)
+
+func printHunks(hunks []Hunk, color bool) {
+	for _, h := range hunks {
+		if color {
+			fmt.Printf("    %s%s%s\n", ansiCyan, h.Header, ansiReset)
+		} else {
+			fmt.Printf("    %s\n", h.Header)
+		}
+		for _, l := range h.Lines {
+			switch l.Kind {
+			case "del":
+				if color {
+					fmt.Printf("    %s-%s%s\n", ansiRed, l.Text, ansiReset)
+				} else {
+					fmt.Printf("    -%s\n", l.Text)
+				}
+			case "add":
+				if color {
+					fmt.Printf("    %s+%s%s\n", ansiGreen, l.Text, ansiReset)
+				} else {
+					fmt.Printf("    +%s\n", l.Text)
+				}
+			default:
+				fmt.Printf("     %s\n", l.Text)
+			}
+		}
+	}
+}
+
+func stdoutIsTTY() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+type jsonHunk struct {
+	Header string `json:"header"`
+	Lines  []struct {
+		Kind string `json:"kind"`
+		Text string `json:"text"`
+	} `json:"lines"`
+}
+
+type jsonResult struct {
+	Path  string     `json:"path"`
+	Count int        `json:"count"`
+	Error string     `json:"error,omitempty"`
+	Hunks []jsonHunk `json:"hunks,omitempty"`
+}
+
+func printResultsJSON(results []Result) {
+	out := make([]jsonResult, len(results))
+	for i, r := range results {
+		jr := jsonResult{Path: r.Path, Count: r.Replacements}
+		if r.Err != nil {
+			jr.Error = r.Err.Error()
+		}
+		for _, h := range r.Hunks {
+			jh := jsonHunk{Header: h.Header}
+			for _, l := range h.Lines {
+				jh.Lines = append(jh.Lines, struct {
+					Kind string `json:"kind"`
+					Text string `json:"text"`
+				}{Kind: l.Kind, Text: l.Text})
+			}
+			jr.Hunks = append(jr.Hunks, jh)
+		}
+		out[i] = jr
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
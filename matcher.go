@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a single compiled gitignore-style pattern.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	include bool // for cliRules: true = -include, false = -exclude
+	negate  bool // for ignore-file rules: "!" re-includes a previously excluded path
+	dirOnly bool
+	baseDir string // root-relative directory the rule was loaded from ("" for cli rules and root)
+}
+
+// PathMatcher decides whether a path discovered while walking a directory
+// should be processed. It combines the -include/-exclude flags given on the
+// command line with any .gitignore/.replaceignore files found while
+// walking, following git's own precedence: the closest ignore file wins,
+// a "!" pattern can re-include a path an ancestor excluded, and explicit
+// -include/-exclude flags always have the final say.
+type PathMatcher struct {
+	root            string
+	cliRules        []ignoreRule
+	fileRules       []ignoreRule
+	loadedDirs      map[string]bool
+	hasIncludeRules bool // true if at least one -include pattern was given
+}
+
+// cliRule is a raw -include/-exclude pattern captured during flag parsing,
+// in the order the flags were given.
+type cliRule struct {
+	raw     string
+	include bool
+}
+
+// cliPatternFlag adapts a repeatable -include/-exclude flag to flag.Value,
+// appending each occurrence to rules in the order it was given on the
+// command line.
+type cliPatternFlag struct {
+	rules   *[]cliRule
+	include bool
+}
+
+func newCLIPatternFlag(rules *[]cliRule, include bool) *cliPatternFlag {
+	return &cliPatternFlag{rules: rules, include: include}
+}
+
+func (f *cliPatternFlag) String() string { return "" }
+
+func (f *cliPatternFlag) Set(v string) error {
+	*f.rules = append(*f.rules, cliRule{raw: v, include: f.include})
+	return nil
+}
+
+// NewPathMatcher builds a PathMatcher rooted at root, compiling the given
+// CLI patterns in the order they were provided.
+func NewPathMatcher(root string, rules []cliRule) (*PathMatcher, error) {
+	m := &PathMatcher{root: root, loadedDirs: map[string]bool{}}
+
+	for _, r := range rules {
+		rule, err := compilePattern(r.raw, "")
+		if err != nil {
+			return nil, err
+		}
+		rule.include = r.include
+		if rule.negate {
+			rule.include = !rule.include
+		}
+		if r.include {
+			m.hasIncludeRules = true
+		}
+		m.cliRules = append(m.cliRules, rule)
+	}
+
+	return m, nil
+}
+
+// LoadIgnoreFiles reads .gitignore and .replaceignore from dir, if present,
+// and registers their rules scoped to that directory. It is a no-op if dir
+// has already been loaded. Call it once per directory as it is visited,
+// before deciding whether to descend into its children.
+func (m *PathMatcher) LoadIgnoreFiles(dir string) error {
+	if m.loadedDirs[dir] {
+		return nil
+	}
+	m.loadedDirs[dir] = true
+
+	baseDir, err := filepath.Rel(m.root, dir)
+	if err != nil {
+		return err
+	}
+	if baseDir == "." {
+		baseDir = ""
+	}
+	baseDir = filepath.ToSlash(baseDir)
+
+	for _, name := range []string{".gitignore", ".replaceignore"} {
+		rules, err := loadIgnoreFile(filepath.Join(dir, name), baseDir)
+		if err != nil {
+			return err
+		}
+		m.fileRules = append(m.fileRules, rules...)
+	}
+
+	return nil
+}
+
+func loadIgnoreFile(path, baseDir string) ([]ignoreRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := compilePattern(line, baseDir)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// compilePattern compiles a single gitignore-style pattern, scoped to
+// baseDir (root-relative, "" meaning the tree root).
+func compilePattern(raw, baseDir string) (ignoreRule, error) {
+	pattern := raw
+	negate := false
+	if strings.HasPrefix(pattern, "!") {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	dirOnly := false
+	if strings.HasSuffix(pattern, "/") && pattern != "/" {
+		dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.Contains(pattern, "/") {
+		anchored = true
+	}
+
+	body, err := globToRegexBody(pattern)
+	if err != nil {
+		return ignoreRule{}, err
+	}
+
+	var full string
+	if anchored {
+		full = "^" + body + "$"
+	} else {
+		full = "^(?:.*/)?" + body + "$"
+	}
+
+	re, err := regexp.Compile(full)
+	if err != nil {
+		return ignoreRule{}, err
+	}
+
+	return ignoreRule{re: re, negate: negate, dirOnly: dirOnly, baseDir: baseDir}, nil
+}
+
+// globToRegexBody translates a gitignore-style glob (supporting "**", "*",
+// "?" and "[...]" character classes) into the body of a regexp, without
+// the surrounding "^"/"$" anchors.
+func globToRegexBody(pattern string) (string, error) {
+	var sb strings.Builder
+	runes := []rune(pattern)
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch c {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				switch {
+				case i+2 < len(runes) && runes[i+2] == '/':
+					sb.WriteString("(?:.*/)?")
+					i += 2
+				default:
+					sb.WriteString(".*")
+					i++
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			j := i + 1
+			for j < len(runes) && runes[j] != ']' {
+				j++
+			}
+			if j < len(runes) {
+				sb.WriteString(string(runes[i : j+1]))
+				i = j
+			} else {
+				sb.WriteString(`\[`)
+			}
+		case '.', '+', '(', ')', '|', '^', '$', '{', '}', '\\':
+			sb.WriteString(`\` + string(c))
+		default:
+			sb.WriteString(string(c))
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// ShouldInclude reports whether relPath (slash-separated, relative to the
+// matcher's root) should be processed. isDir is true when relPath names a
+// directory being considered for descent.
+func (m *PathMatcher) ShouldInclude(relPath string, isDir bool) bool {
+	included := true
+
+	for _, r := range m.fileRules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		sub, ok := relativeTo(relPath, r.baseDir)
+		if !ok {
+			continue
+		}
+		if r.re.MatchString(sub) {
+			included = r.negate
+		}
+	}
+
+	matchedInclude := false
+	for _, r := range m.cliRules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(relPath) {
+			included = r.include
+			if r.include {
+				matchedInclude = true
+			}
+		}
+	}
+
+	// When the user gave at least one -include pattern, files must match
+	// one of them to be processed. Directories are exempt: they must still
+	// be descended into so an included file deeper down can be reached.
+	if !isDir && m.hasIncludeRules && !matchedInclude {
+		included = false
+	}
+
+	return included
+}
+
+// relativeTo reports whether relPath falls under baseDir and, if so,
+// returns relPath expressed relative to baseDir.
+func relativeTo(relPath, baseDir string) (string, bool) {
+	if baseDir == "" {
+		return relPath, true
+	}
+	prefix := baseDir + "/"
+	if !strings.HasPrefix(relPath, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(relPath, prefix), true
+}
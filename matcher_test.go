@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestShouldIncludeDefaultIncludesEverything(t *testing.T) {
+	m, err := NewPathMatcher(".", nil)
+	if err != nil {
+		t.Fatalf("NewPathMatcher: %v", err)
+	}
+
+	if !m.ShouldInclude("main.go", false) {
+		t.Error("expected file to be included by default when no rules are given")
+	}
+	if !m.ShouldInclude("sub", true) {
+		t.Error("expected directory to be included by default when no rules are given")
+	}
+}
+
+func TestShouldIncludeExcludePattern(t *testing.T) {
+	m, err := NewPathMatcher(".", []cliRule{
+		{raw: "*.log", include: false},
+	})
+	if err != nil {
+		t.Fatalf("NewPathMatcher: %v", err)
+	}
+
+	if m.ShouldInclude("debug.log", false) {
+		t.Error("expected debug.log to be excluded")
+	}
+	if !m.ShouldInclude("main.go", false) {
+		t.Error("expected main.go to remain included")
+	}
+}
+
+func TestShouldIncludeWhitelistSemantics(t *testing.T) {
+	m, err := NewPathMatcher(".", []cliRule{
+		{raw: "*.go", include: true},
+	})
+	if err != nil {
+		t.Fatalf("NewPathMatcher: %v", err)
+	}
+
+	if !m.ShouldInclude("main.go", false) {
+		t.Error("expected main.go to match the -include pattern")
+	}
+	if m.ShouldInclude("README.md", false) {
+		t.Error("expected README.md to be excluded: it matches no -include pattern")
+	}
+}
+
+func TestShouldIncludeWhitelistExemptsDirectories(t *testing.T) {
+	m, err := NewPathMatcher(".", []cliRule{
+		{raw: "*.go", include: true},
+	})
+	if err != nil {
+		t.Fatalf("NewPathMatcher: %v", err)
+	}
+
+	if !m.ShouldInclude("sub", true) {
+		t.Error("expected directories to still be descended into despite not matching any -include pattern")
+	}
+}
+
+func TestShouldIncludeCLIRulesOverrideFileRules(t *testing.T) {
+	m, err := NewPathMatcher(".", []cliRule{
+		{raw: "vendor/", include: true},
+	})
+	if err != nil {
+		t.Fatalf("NewPathMatcher: %v", err)
+	}
+	fileRule, err := compilePattern("vendor/", "")
+	if err != nil {
+		t.Fatalf("compilePattern: %v", err)
+	}
+	m.fileRules = append(m.fileRules, fileRule)
+
+	if !m.ShouldInclude("vendor", true) {
+		t.Error("expected -include to override a .gitignore exclusion")
+	}
+}
+
+func TestShouldIncludeLastMatchingRuleWins(t *testing.T) {
+	m, err := NewPathMatcher(".", []cliRule{
+		{raw: "*.go", include: false},
+		{raw: "main.go", include: true},
+	})
+	if err != nil {
+		t.Fatalf("NewPathMatcher: %v", err)
+	}
+
+	if !m.ShouldInclude("main.go", false) {
+		t.Error("expected the later, more specific -include rule to win")
+	}
+	if m.ShouldInclude("stream.go", false) {
+		t.Error("expected stream.go to stay excluded by the earlier -exclude rule")
+	}
+}
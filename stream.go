@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// defaultStreamThreshold is the file size above which replaceInFile
+// switches from loading the whole file into memory to streaming it
+// through a bounded sliding window.
+const defaultStreamThreshold = 8 * 1024 * 1024
+
+// streamReplaceInFile replaces every occurrence of oldWord with newWord in
+// path without holding the whole file in memory, so a handful of large
+// files being processed by parallel workers cannot OOM the process. The
+// result is written to a temp file in the same directory and renamed over
+// path on success; if journal is non-nil, the original bytes are streamed
+// to a content-addressed backup as they are read.
+func streamReplaceInFile(path, oldWord, newWord string, mode fs.FileMode, journal *Journal) (int, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dir := filepath.Dir(path)
+
+	outFile, err := os.CreateTemp(dir, ".replace-*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	outPath := outFile.Name()
+	defer func() {
+		outFile.Close()
+		os.Remove(outPath)
+	}()
+
+	var reader io.Reader = src
+	var backupFile *os.File
+	var backupPath string
+	beforeHash := sha256.New()
+
+	if journal != nil {
+		backupFile, err = os.CreateTemp(filepath.Join(journal.Dir, "backups"), ".tmp-*")
+		if err != nil {
+			return 0, err
+		}
+		backupPath = backupFile.Name()
+		defer func() {
+			if backupFile != nil {
+				backupFile.Close()
+				os.Remove(backupPath)
+			}
+		}()
+		reader = io.TeeReader(src, io.MultiWriter(backupFile, beforeHash))
+	}
+
+	afterHash := sha256.New()
+	writer := bufio.NewWriter(io.MultiWriter(outFile, afterHash))
+
+	count, err := streamReplace(reader, writer, []byte(oldWord), []byte(newWord))
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		// Nothing matched: leave the original file untouched and let the
+		// deferred cleanup discard the temp output/backup files.
+		return 0, nil
+	}
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+	if err := outFile.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Chmod(outPath, mode); err != nil {
+		return 0, err
+	}
+
+	if journal != nil {
+		if err := backupFile.Close(); err != nil {
+			return 0, err
+		}
+		shaBefore := hex.EncodeToString(beforeHash.Sum(nil))
+		shaAfter := hex.EncodeToString(afterHash.Sum(nil))
+
+		if err := journal.adoptBackup(backupPath, shaBefore); err != nil {
+			return 0, err
+		}
+		backupFile = nil
+
+		if err := journal.appendRecord(path, shaBefore, shaAfter, mode); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := os.Rename(outPath, path); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// streamReplace copies r to w, replacing every occurrence of old with new.
+// It reads into a window of at least 64KiB (or 2*len(old), whichever is
+// larger) and only flushes bytes once it is certain they cannot be the
+// start of a match that straddles the next read, by always keeping the
+// final len(old)-1 bytes of the window in reserve until a refill proves
+// them safe or EOF is reached.
+func streamReplace(r io.Reader, w io.Writer, old, repl []byte) (int, error) {
+	if len(old) == 0 {
+		_, err := io.Copy(w, r)
+		return 0, err
+	}
+
+	winSize := 64 * 1024
+	if need := 2 * len(old); need > winSize {
+		winSize = need
+	}
+	chunk := make([]byte, winSize)
+
+	var buf []byte
+	count := 0
+	eof := false
+
+	for {
+		if !eof && len(buf) < winSize {
+			n, err := r.Read(chunk)
+			if n > 0 {
+				buf = append(buf, chunk[:n]...)
+			}
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					eof = true
+				} else {
+					return count, err
+				}
+			}
+			if !eof && len(buf) < winSize {
+				continue
+			}
+		}
+
+		if idx := bytes.Index(buf, old); idx != -1 {
+			if _, err := w.Write(buf[:idx]); err != nil {
+				return count, err
+			}
+			if _, err := w.Write(repl); err != nil {
+				return count, err
+			}
+			buf = buf[idx+len(old):]
+			count++
+			continue
+		}
+
+		safeLen := len(buf) - (len(old) - 1)
+		if eof || safeLen < 0 {
+			safeLen = len(buf)
+		}
+		if safeLen > 0 {
+			if _, err := w.Write(buf[:safeLen]); err != nil {
+				return count, err
+			}
+			buf = buf[safeLen:]
+		}
+
+		if eof {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStreamReplaceBasic(t *testing.T) {
+	var out bytes.Buffer
+	count, err := streamReplace(strings.NewReader("hello world, hello there"), &out, []byte("hello"), []byte("goodbye"))
+	if err != nil {
+		t.Fatalf("streamReplace: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+	if got, want := out.String(), "goodbye world, goodbye there"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestStreamReplaceNoMatch(t *testing.T) {
+	var out bytes.Buffer
+	count, err := streamReplace(strings.NewReader("nothing to see here"), &out, []byte("xyz"), []byte("abc"))
+	if err != nil {
+		t.Fatalf("streamReplace: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("count = %d, want 0", count)
+	}
+	if got, want := out.String(), "nothing to see here"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestStreamReplaceEmptyOld(t *testing.T) {
+	var out bytes.Buffer
+	count, err := streamReplace(strings.NewReader("unchanged"), &out, []byte(""), []byte("x"))
+	if err != nil {
+		t.Fatalf("streamReplace: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("count = %d, want 0", count)
+	}
+	if got, want := out.String(), "unchanged"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+// TestStreamReplaceReassemblesPartialReads feeds the scanner one small Read
+// at a time so a match spread across many reads must still be found.
+func TestStreamReplaceReassemblesPartialReads(t *testing.T) {
+	old := "supercalifragilisticexpialidocious"
+	input := "prefix-" + old + "-suffix"
+
+	r := &chunkedReader{data: []byte(input), size: 4}
+	var out bytes.Buffer
+	count, err := streamReplace(r, &out, []byte(old), []byte("X"))
+	if err != nil {
+		t.Fatalf("streamReplace: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("count = %d, want 1", count)
+	}
+	if got, want := out.String(), "prefix-X-suffix"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestStreamReplaceAdjacentMatches(t *testing.T) {
+	var out bytes.Buffer
+	count, err := streamReplace(strings.NewReader("aaaa"), &out, []byte("aa"), []byte("b"))
+	if err != nil {
+		t.Fatalf("streamReplace: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+	if got, want := out.String(), "bb"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+// chunkedReader returns at most size bytes per Read call, to exercise
+// streamReplace's window-refill logic with reads much smaller than a match.
+type chunkedReader struct {
+	data []byte
+	size int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := r.size
+	if n > len(p) {
+		n = len(p)
+	}
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}